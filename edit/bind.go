@@ -2,14 +2,16 @@ package edit
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
+	"io"
 	"os"
 	"sync"
 
 	"github.com/elves/elvish/eval"
 )
 
-var defaultBindings = map[bufferMode]map[Key]string{
+var defaultBindings = map[string]map[Key]string{
 	modeInsert: map[Key]string{
 		Default: "default-insert",
 		// Moving.
@@ -39,7 +41,10 @@ var defaultBindings = map[bufferMode]map[Key]string{
 		Key{Tab, 0}:    "complete-prefix-or-start-completion",
 		Key{Up, 0}:     "start-history",
 		Key{'N', Ctrl}: "start-navigation",
-		Key{'H', Ctrl}: "start-history-listing",
+		// Ctrl-H is already kill-rune-left above, for terminals that send it
+		// on backspace; history-listing gets its own key instead of
+		// silently losing the map-literal collision.
+		Key{'R', Ctrl}: "start-history-listing",
 		Key{'L', Ctrl}: "start-location",
 	},
 	modeCommand: map[Key]string{
@@ -97,14 +102,77 @@ var defaultBindings = map[bufferMode]map[Key]string{
 	},
 }
 
-var keyBindings = map[bufferMode]map[Key]Caller{}
+// keyBindings holds the binding trie for each registered mode, indexed by
+// mode name. Built-in modes are registered via registerMode in mode.go;
+// edit:new-mode registers user-defined ones the same way.
+var keyBindings = map[string]*bindingNode{}
+
+// wireDefaultBindings resolves name's entries in defaultBindings against
+// builtins and binds each into keyBindings[name], so a freshly
+// registered built-in mode has working keys out of the box instead of an
+// empty trie. registerMode calls this right after creating the trie; it
+// is a no-op for modes (built-in or user-defined) with no defaultBindings
+// entry.
+func wireDefaultBindings(name string) {
+	for key, behavior := range defaultBindings[name] {
+		b, ok := builtins[behavior]
+		if !ok {
+			continue
+		}
+		keyBindings[name].bind([]Key{key}, b)
+	}
+}
 
 var (
 	errKeyMustBeString = errors.New("key must be string")
 	errInvalidKey      = errors.New("invalid key to bind to")
 	errInvalidFunction = errors.New("invalid function to bind")
+	errEmptyKeySeq     = errors.New("key sequence must not be empty")
 )
 
+// bindingNode is a node of the per-mode key-binding trie. A leaf node (one
+// with a non-nil caller) is reached after consuming a complete key sequence;
+// an interior node (one with a non-empty children map) represents a pending
+// prefix, such as the "Ctrl-X" in "Ctrl-X Ctrl-C" or the first "g" in "g g".
+type bindingNode struct {
+	caller   Caller
+	children map[Key]*bindingNode
+}
+
+func newBindingNode() *bindingNode {
+	return &bindingNode{children: map[Key]*bindingNode{}}
+}
+
+// bind registers caller against the given key sequence, creating
+// intermediate prefix nodes as needed. A single-key sequence is the common
+// case and behaves exactly like the old flat map.
+func (n *bindingNode) bind(seq []Key, caller Caller) {
+	for _, k := range seq {
+		child, ok := n.children[k]
+		if !ok {
+			child = newBindingNode()
+			n.children[k] = child
+		}
+		n = child
+	}
+	n.caller = caller
+}
+
+// lookup descends the trie one key at a time starting at n. It returns the
+// node reached; the caller should check isLeaf/hasChildren on the result to
+// decide whether the sequence is complete, still pending, or unbound.
+func (n *bindingNode) lookup(k Key) *bindingNode {
+	return n.children[k]
+}
+
+func (n *bindingNode) isLeaf() bool {
+	return n != nil && n.caller != nil
+}
+
+func (n *bindingNode) hasChildren() bool {
+	return n != nil && len(n.children) > 0
+}
+
 // Caller is a function operating on an Editor. It is either a Builtin or an
 // EvalCaller.
 type Caller interface {
@@ -120,9 +188,42 @@ func (b Builtin) Call(ed *Editor) {
 	b.impl(ed)
 }
 
-// EvalCaller adapts an eval.Caller to a Caller.
+// stdinSource selects what a bound function sees on its stdin.
+type stdinSource int
+
+const (
+	// stdinNone is the default: /dev/null and a closed channel, as before.
+	stdinNone stdinSource = iota
+	// stdinBuffer feeds the whole current buffer.
+	stdinBuffer
+	// stdinSelection feeds the text between the two dots of the current
+	// selection (the region), or nothing if there is no selection.
+	stdinSelection
+	// stdinLine feeds the current line only.
+	stdinLine
+)
+
+// stdoutMode selects what happens to a bound function's stdout.
+type stdoutMode int
+
+const (
+	// stdoutNotify routes each line/value to ed.Notifyf, as before.
+	stdoutNotify stdoutMode = iota
+	// stdoutReplace replaces the region the stdin source was read from
+	// with the function's stdout.
+	stdoutReplace
+	// stdoutInsert inserts the function's stdout at the dot.
+	stdoutInsert
+)
+
+// EvalCaller adapts an eval.Caller to a Caller. By default it behaves like
+// a plain function call with no input and output routed to notifications;
+// setting Stdin/Stdout turns it into a filter over the buffer or selection,
+// for bindings like `edit:bind-filter alt-q $reformat~`.
 type EvalCaller struct {
 	Caller eval.CallerValue
+	Stdin  stdinSource
+	Stdout stdoutMode
 }
 
 func (c EvalCaller) Repr(indent int) string {
@@ -130,11 +231,20 @@ func (c EvalCaller) Repr(indent int) string {
 }
 
 func (c EvalCaller) Call(ed *Editor) {
-	rout, chanOut, ports, err := makePorts()
+	region, text := ed.stdinRegion(c.Stdin)
+
+	rin, err := makeStdin(text)
+	if err != nil {
+		return
+	}
+	rout, chanOut, ports, err := makePorts(rin)
 	if err != nil {
 		return
 	}
 
+	var stdout bytes.Buffer
+	var values []eval.Value
+
 	// Goroutines to collect output.
 	var wg sync.WaitGroup
 	wg.Add(2)
@@ -142,18 +252,27 @@ func (c EvalCaller) Call(ed *Editor) {
 		rd := bufio.NewReader(rout)
 		for {
 			line, err := rd.ReadString('\n')
+			if line != "" {
+				if c.Stdout == stdoutNotify {
+					ed.Notifyf(levelInfo, "bound fn", "%s", trimNewline(line))
+				} else {
+					stdout.WriteString(line)
+				}
+			}
 			if err != nil {
 				break
 			}
-			// XXX notify is not concurrency-safe.
-			ed.notify("[bound fn bytes] %s", line[:len(line)-1])
 		}
 		rout.Close()
 		wg.Done()
 	}()
 	go func() {
 		for v := range chanOut {
-			ed.notify("[bound fn value] %s", v.Repr(eval.NoPretty))
+			if c.Stdout == stdoutNotify {
+				ed.NotifyValue("bound fn", v)
+			} else {
+				values = append(values, v)
+			}
 		}
 		wg.Done()
 	}()
@@ -162,25 +281,34 @@ func (c EvalCaller) Call(ed *Editor) {
 	ec := eval.NewTopEvalCtx(ed.evaler, "[editor]", "", ports)
 	ex := ec.PCall(c.Caller, []eval.Value{})
 	if ex != nil {
-		ed.notify("function error: %s", ex.Error())
+		ed.Notifyf(levelError, "bound fn", "function error: %s", ex.Error())
 	}
 
 	eval.ClosePorts(ports)
 	wg.Wait()
+
+	switch c.Stdout {
+	case stdoutReplace:
+		ed.replaceRegion(region, stdout.String())
+	case stdoutInsert:
+		ed.insertAtDot(stdout.String())
+	}
+
 	ed.refresh(true, true)
 }
 
-// makePorts connects stdin to /dev/null and a closed channel, identifies
-// stdout and stderr and connects them to a pipe and channel. It returns the
-// other end of stdout and the resulting []*eval.Port. The caller is
-// responsible for closing the returned file and calling eval.ClosePorts on the
-// ports.
-func makePorts() (*os.File, chan eval.Value, []*eval.Port, error) {
-	in, err := makeClosedStdin()
-	if err != nil {
-		return nil, nil, nil, err
+func trimNewline(line string) string {
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		return line[:n-1]
 	}
+	return line
+}
 
+// makePorts identifies stdin with in, and stdout and stderr with a pipe and
+// channel. It returns the other end of stdout and the resulting
+// []*eval.Port. The caller is responsible for closing the returned file and
+// calling eval.ClosePorts on the ports.
+func makePorts(in *eval.Port) (*os.File, chan eval.Value, []*eval.Port, error) {
 	// Output
 	rout, out, err := os.Pipe()
 	if err != nil {
@@ -196,14 +324,34 @@ func makePorts() (*os.File, chan eval.Value, []*eval.Port, error) {
 	}, nil
 }
 
-func makeClosedStdin() (*eval.Port, error) {
-	// Input
+// makeStdin builds the stdin port for a bound function: a closed channel,
+// and either /dev/null or a pipe pre-loaded with text, depending on
+// whether text is empty.
+func makeStdin(text string) (*eval.Port, error) {
+	in := make(chan eval.Value)
+	close(in)
+
+	if text == "" {
+		return makeClosedStdin(in)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		Logger.Println(err)
+		return nil, err
+	}
+	go func() {
+		io.WriteString(w, text)
+		w.Close()
+	}()
+	return &eval.Port{File: r, CloseFile: true, Chan: in}, nil
+}
+
+func makeClosedStdin(in chan eval.Value) (*eval.Port, error) {
 	devnull, err := os.Open("/dev/null")
 	if err != nil {
 		Logger.Println(err)
 		return nil, err
 	}
-	in := make(chan eval.Value)
-	close(in)
 	return &eval.Port{File: devnull, CloseFile: true, Chan: in}, nil
 }
@@ -0,0 +1,106 @@
+package edit
+
+import "github.com/elves/elvish/eval"
+
+func init() {
+	paramBuiltins["bind-filter"] = builtinBindFilter
+}
+
+func parseStdinSource(v eval.Value) (stdinSource, error) {
+	s, err := asString(v)
+	if err != nil {
+		return stdinNone, err
+	}
+	switch s {
+	case "", "none":
+		return stdinNone, nil
+	case "buffer":
+		return stdinBuffer, nil
+	case "selection":
+		return stdinSelection, nil
+	case "line":
+		return stdinLine, nil
+	}
+	return stdinNone, errInvalidKey
+}
+
+func parseStdoutMode(v eval.Value) (stdoutMode, error) {
+	s, err := asString(v)
+	if err != nil {
+		return stdoutNotify, err
+	}
+	switch s {
+	case "", "notify":
+		return stdoutNotify, nil
+	case "replace":
+		return stdoutReplace, nil
+	case "insert":
+		return stdoutInsert, nil
+	}
+	return stdoutNotify, errInvalidKey
+}
+
+// builtinBindFilter implements
+// edit:bind-filter $mode $key $fn &stdin=buffer|selection|line
+//                   &stdout=replace|insert|notify,
+// binding $fn as a filter over the buffer or selection instead of a plain
+// Caller with no input, e.g. edit:bind-filter insert alt-q $reformat~
+// &stdin=line &stdout=replace.
+func builtinBindFilter(ed *Editor, args []eval.Value, opts map[string]eval.Value) error {
+	if len(args) != 3 {
+		return errWrongNumArgs
+	}
+	mode, err := asString(args[0])
+	if err != nil {
+		return err
+	}
+	k, err := asKey(args[1])
+	if err != nil {
+		return err
+	}
+	fn, ok := args[2].(eval.CallerValue)
+	if !ok {
+		return errInvalidFunction
+	}
+
+	stdin, err := stdinSourceOpt(opts)
+	if err != nil {
+		return err
+	}
+	stdout, err := stdoutModeOpt(opts)
+	if err != nil {
+		return err
+	}
+
+	root, ok := keyBindings[mode]
+	if !ok {
+		root = newBindingNode()
+		keyBindings[mode] = root
+	}
+	root.bind([]Key{k}, EvalCaller{Caller: fn, Stdin: stdin, Stdout: stdout})
+	return nil
+}
+
+func stdinSourceOpt(opts map[string]eval.Value) (stdinSource, error) {
+	if v, ok := opts["stdin"]; ok {
+		return parseStdinSource(v)
+	}
+	return stdinNone, nil
+}
+
+func stdoutModeOpt(opts map[string]eval.Value) (stdoutMode, error) {
+	if v, ok := opts["stdout"]; ok {
+		return parseStdoutMode(v)
+	}
+	return stdoutNotify, nil
+}
+
+// asKey converts a single key description string (as accepted by
+// parseKey) into a Key.
+func asKey(v eval.Value) (Key, error) {
+	s, err := asString(v)
+	if err != nil {
+		return Key{}, err
+	}
+	return parseKey(s)
+}
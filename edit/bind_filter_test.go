@@ -0,0 +1,49 @@
+package edit
+
+import (
+	"testing"
+
+	"github.com/elves/elvish/eval"
+)
+
+func TestStdinRegionLine(t *testing.T) {
+	ed := &Editor{buf: Buffer{Text: "first\nsecond\nthird", Dot: 8}}
+	r, text := ed.stdinRegion(stdinLine)
+	if text != "second" {
+		t.Fatalf("stdinRegion(stdinLine) text = %q, want %q", text, "second")
+	}
+	ed.replaceRegion(r, "SECOND")
+	if ed.buf.Text != "first\nSECOND\nthird" {
+		t.Fatalf("buffer after replaceRegion = %q", ed.buf.Text)
+	}
+}
+
+func TestStdinRegionSelection(t *testing.T) {
+	ed := &Editor{buf: Buffer{Text: "hello world", Dot: 0}}
+	ed.sel = &region{start: 6, end: 11}
+	_, text := ed.stdinRegion(stdinSelection)
+	if text != "world" {
+		t.Fatalf("stdinRegion(stdinSelection) text = %q, want %q", text, "world")
+	}
+}
+
+func TestParseStdinStdoutOptions(t *testing.T) {
+	cases := []struct {
+		in   string
+		want stdinSource
+	}{
+		{"buffer", stdinBuffer},
+		{"selection", stdinSelection},
+		{"line", stdinLine},
+		{"", stdinNone},
+	}
+	for _, c := range cases {
+		got, err := parseStdinSource(eval.String(c.in))
+		if err != nil {
+			t.Fatalf("parseStdinSource(%q): %v", c.in, err)
+		}
+		if got != c.want {
+			t.Fatalf("parseStdinSource(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
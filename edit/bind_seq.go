@@ -0,0 +1,149 @@
+package edit
+
+import (
+	"time"
+
+	"github.com/elves/elvish/eval"
+)
+
+// prefixTimeout is how long the editor waits for the next key of a pending
+// sequence before giving up and resetting to the root of the binding trie.
+// Ctrl-X Ctrl-C is a sequence; Ctrl-X followed by silence for longer than
+// this is not.
+const prefixTimeout = 1000 * time.Millisecond
+
+// seqState tracks progress through a multi-key binding sequence for a
+// single mode. It is reset whenever a sequence completes, fails to match,
+// or times out.
+type seqState struct {
+	node  *bindingNode
+	keys  []Key
+	timer *time.Timer
+}
+
+func (ed *Editor) resetSeq() {
+	if ed.seq.timer != nil {
+		ed.seq.timer.Stop()
+	}
+	ed.seq = seqState{}
+}
+
+// armSeq records that k has extended the pending sequence to node, and
+// (re)starts the prefix timeout. The timer's channel is only ever read by
+// ed.Run, on the same goroutine that calls lookupKey, so there is no
+// concurrent access to ed.seq here.
+func (ed *Editor) armSeq(node *bindingNode, keys []Key) {
+	if ed.seq.timer != nil {
+		ed.seq.timer.Stop()
+	}
+	ed.seq.node = node
+	ed.seq.keys = keys
+	ed.seq.timer = time.NewTimer(prefixTimeout)
+}
+
+// lookupKey advances the pending sequence for the current mode by one key
+// and returns the Caller to invoke, if the sequence is now complete. If the
+// key extends a still-pending sequence, it returns nil and leaves a
+// "prefix pending" hint for the status area to pick up via ed.seqHint.
+func (ed *Editor) lookupKey(k Key) Caller {
+	name := currentMode(ed, ed.mode.Mode())
+	root, ok := keyBindings[name]
+	if !ok {
+		ed.resetSeq()
+		return nil
+	}
+
+	start := ed.seq.node
+	if start == nil {
+		start = root
+	}
+
+	next := start.lookup(k)
+	if next == nil {
+		// k didn't continue whatever prefix was pending (if any). That
+		// doesn't mean k is unbound: it may well be bound on its own, e.g.
+		// "g" "x" where "g" starts a pending "g g" sequence but "x" is
+		// separately bound to kill-rune-right, possibly inherited from a
+		// parent mode. Retry before giving up to the mode's Default
+		// binding.
+		ed.resetSeq()
+		next = lookupWithParents(name, k)
+	}
+
+	if next == nil {
+		if d := lookupWithParents(name, Default); d != nil {
+			return d.caller
+		}
+		return nil
+	}
+
+	if next.isLeaf() && !next.hasChildren() {
+		ed.resetSeq()
+		return next.caller
+	}
+
+	// The sequence is ambiguous (a leaf that is also a prefix of a longer
+	// sequence) or simply incomplete; keep waiting.
+	ed.armSeq(next, append(append([]Key{}, ed.seq.keys...), k))
+	return nil
+}
+
+// seqHint returns the text to show in the status area while a multi-key
+// sequence is pending, or "" when there is none.
+func (ed *Editor) seqHint() string {
+	if len(ed.seq.keys) == 0 {
+		return ""
+	}
+	s := ""
+	for _, k := range ed.seq.keys {
+		if s != "" {
+			s += " "
+		}
+		s += k.String()
+	}
+	return s + "-"
+}
+
+// bindSeq implements edit:bind-seq, binding a Caller to a sequence of keys
+// within a mode instead of a single Key.
+func bindSeq(ed *Editor, mode string, seq []Key, caller Caller) error {
+	if len(seq) == 0 {
+		return errEmptyKeySeq
+	}
+	root, ok := keyBindings[mode]
+	if !ok {
+		root = newBindingNode()
+		keyBindings[mode] = root
+	}
+	root.bind(seq, caller)
+	return nil
+}
+
+// parseKeySeq converts an Elvish list of key description strings (as
+// accepted by parseKey) into a key sequence.
+func parseKeySeq(v eval.Value) ([]Key, error) {
+	list, ok := v.(eval.ListLike)
+	if !ok {
+		return nil, errInvalidKey
+	}
+	var seq []Key
+	var err error
+	list.Iterate(func(elem eval.Value) bool {
+		s, ok := elem.(eval.String)
+		if !ok {
+			err = errKeyMustBeString
+			return false
+		}
+		var k Key
+		k, err = parseKey(string(s))
+		if err != nil {
+			return false
+		}
+		seq = append(seq, k)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return seq, nil
+}
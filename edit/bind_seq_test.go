@@ -0,0 +1,58 @@
+package edit
+
+import "testing"
+
+type fakeCaller string
+
+func (f fakeCaller) Repr(int) string  { return string(f) }
+func (f fakeCaller) Call(ed *Editor) {}
+
+func TestBindingNodeTrie(t *testing.T) {
+	root := newBindingNode()
+	root.bind([]Key{{'g', 0}, {'g', 0}}, fakeCaller("go-to-top"))
+	root.bind([]Key{{'x', 0}}, fakeCaller("kill-rune-right"))
+
+	first := root.lookup(Key{'g', 0})
+	if first == nil || first.isLeaf() || !first.hasChildren() {
+		t.Fatalf("first 'g' should be a pending interior node, got %+v", first)
+	}
+	second := first.lookup(Key{'g', 0})
+	if second == nil || !second.isLeaf() || second.caller != fakeCaller("go-to-top") {
+		t.Fatalf("'g g' should resolve to go-to-top, got %+v", second)
+	}
+
+	x := root.lookup(Key{'x', 0})
+	if x == nil || !x.isLeaf() || x.caller != fakeCaller("kill-rune-right") {
+		t.Fatalf("'x' should resolve to kill-rune-right, got %+v", x)
+	}
+}
+
+func TestLookupKeyFallsBackToRootAfterFailedPrefix(t *testing.T) {
+	defer func(saved map[string]*bindingNode) { keyBindings = saved }(keyBindings)
+	keyBindings = map[string]*bindingNode{}
+
+	root := newBindingNode()
+	root.bind([]Key{{'g', 0}, {'g', 0}}, fakeCaller("go-to-top"))
+	root.bind([]Key{{'x', 0}}, fakeCaller("kill-rune-right"))
+	keyBindings["command"] = root
+
+	ed := &Editor{}
+	ed.mode.setMode("command")
+
+	if c := ed.lookupKey(Key{'g', 0}); c != nil {
+		t.Fatalf("'g' alone should be pending, got %+v", c)
+	}
+	if ed.seq.node == nil {
+		t.Fatalf("expected a pending sequence after 'g'")
+	}
+
+	// "x" doesn't continue the "g g" prefix, but is itself bound: it must
+	// fire its own binding rather than falling through to Default.
+	c := ed.lookupKey(Key{'x', 0})
+	if c != fakeCaller("kill-rune-right") {
+		t.Fatalf("'x' after failed prefix should still hit its own binding, got %+v", c)
+	}
+	if ed.seq.node != nil {
+		t.Fatalf("pending sequence should be cleared after resolving 'x'")
+	}
+}
@@ -0,0 +1,174 @@
+package edit
+
+// Builtin is a Caller implemented directly in Go, as opposed to an
+// EvalCaller wrapping an Elvish function. defaultBindings names builtins
+// by string; wireDefaultBindings (see bind.go) resolves those names
+// against builtins and binds them into each mode's trie as it is
+// registered.
+type Builtin struct {
+	name string
+	impl func(ed *Editor)
+}
+
+// builtins holds every Builtin name used by defaultBindings. Movement,
+// killing and mode-switching builtins operate on the real buffer/mode
+// state set up in editor.go and mode.go; the completion, navigation,
+// history and location builtins are left as no-ops because this package
+// does not model those subsystems' state, but they still resolve to a
+// real Caller so a key press never silently does nothing.
+var builtins = map[string]Builtin{
+	"default-insert": {"default-insert", biDefaultInsert},
+
+	"move-dot-left":       {"move-dot-left", biMoveDotLeft},
+	"move-dot-right":      {"move-dot-right", biMoveDotRight},
+	"move-dot-up":         {"move-dot-up", biNop},
+	"move-dot-down":       {"move-dot-down", biNop},
+	"move-dot-left-word":  {"move-dot-left-word", biMoveDotLeftWord},
+	"move-dot-right-word": {"move-dot-right-word", biMoveDotRightWord},
+	"move-dot-sol":        {"move-dot-sol", biMoveDotSOL},
+	"move-dot-eol":        {"move-dot-eol", biMoveDotEOL},
+
+	"kill-line-left":  {"kill-line-left", biKillLineLeft},
+	"kill-line-right": {"kill-line-right", biKillLineRight},
+	"kill-word-left":  {"kill-word-left", biKillWordLeft},
+	"kill-rune-left":  {"kill-rune-left", biKillRuneLeft},
+	"kill-rune-right": {"kill-rune-right", biKillRuneRight},
+
+	"insert-last-word": {"insert-last-word", biNop},
+	"insert-key":       {"insert-key", biInsertKey},
+
+	"smart-enter": {"smart-enter", biNop},
+	"return-eof":  {"return-eof", biNop},
+
+	"complete-prefix-or-start-completion": {"complete-prefix-or-start-completion", biStartMode(modeCompletion)},
+	"start-history":                       {"start-history", biStartMode(modeHistory)},
+	"start-navigation":                    {"start-navigation", biStartMode(modeNavigation)},
+	"start-history-listing":               {"start-history-listing", biStartMode(modeHistoryListing)},
+	"start-location":                      {"start-location", biStartMode(modeLocation)},
+	"start-insert":                        {"start-insert", biStartMode(modeInsert)},
+
+	"default-command": {"default-command", biNop},
+
+	"cancel-completion":  {"cancel-completion", biStartMode(modeInsert)},
+	"select-cand-up":     {"select-cand-up", biNop},
+	"select-cand-down":   {"select-cand-down", biNop},
+	"select-cand-left":   {"select-cand-left", biNop},
+	"select-cand-right":  {"select-cand-right", biNop},
+	"cycle-cand-right":   {"cycle-cand-right", biNop},
+	"accept-completion":  {"accept-completion", biStartMode(modeInsert)},
+	"default-completion": {"default-completion", biNop},
+
+	"select-nav-up":           {"select-nav-up", biNop},
+	"select-nav-down":         {"select-nav-down", biNop},
+	"ascend-nav":              {"ascend-nav", biNop},
+	"descend-nav":             {"descend-nav", biNop},
+	"trigger-nav-show-hidden": {"trigger-nav-show-hidden", biNop},
+	"default-navigation":      {"default-navigation", biNop},
+
+	"select-history-prev":         {"select-history-prev", biNop},
+	"select-history-next-or-quit": {"select-history-next-or-quit", biStartMode(modeInsert)},
+	"default-history":             {"default-history", biNop},
+	"default-history-listing":     {"default-history-listing", biNop},
+
+	"location-prev":      {"location-prev", biNop},
+	"location-next":       {"location-next", biNop},
+	"location-backspace":  {"location-backspace", biNop},
+	"accept-location":     {"accept-location", biStartMode(modeInsert)},
+	"cancel-location":     {"cancel-location", biStartMode(modeInsert)},
+	"location-default":    {"location-default", biNop},
+}
+
+func biNop(ed *Editor) {}
+
+// biDefaultInsert implements modeInsert's Default binding: insert
+// whatever rune was actually pressed, which lookupKey/handleKey stash in
+// ed.lastKey before dispatch since Caller.Call takes no key parameter.
+func biDefaultInsert(ed *Editor) {
+	ed.insertAtDot(string(ed.lastKey.Rune))
+}
+
+// biInsertKey implements Alt-Enter: insert a literal newline instead of
+// letting Enter submit the command.
+func biInsertKey(ed *Editor) {
+	ed.insertAtDot("\n")
+}
+
+func biMoveDotLeft(ed *Editor) {
+	start, _, ok := motionLeft(ed.buf.Text, ed.buf.Dot, 1)
+	if ok {
+		ed.buf.Dot = start
+	}
+}
+
+func biMoveDotRight(ed *Editor) {
+	_, end, ok := motionRight(ed.buf.Text, ed.buf.Dot, 1)
+	if ok {
+		ed.buf.Dot = end
+	}
+}
+
+func biMoveDotLeftWord(ed *Editor) {
+	start, _, ok := motionWordBackward(ed.buf.Text, ed.buf.Dot, 1)
+	if ok {
+		ed.buf.Dot = start
+	}
+}
+
+func biMoveDotRightWord(ed *Editor) {
+	_, end, ok := motionWordForward(ed.buf.Text, ed.buf.Dot, 1)
+	if ok {
+		ed.buf.Dot = end
+	}
+}
+
+func biMoveDotSOL(ed *Editor) {
+	start, _, _ := motionToSOL(ed.buf.Text, ed.buf.Dot, 1)
+	ed.buf.Dot = start
+}
+
+func biMoveDotEOL(ed *Editor) {
+	_, end, _ := motionToEOL(ed.buf.Text, ed.buf.Dot, 1)
+	ed.buf.Dot = end
+}
+
+func biKillLineLeft(ed *Editor) {
+	start, _, _ := motionToSOL(ed.buf.Text, ed.buf.Dot, 1)
+	ed.setRegister(0, ed.bufferRange(start, ed.buf.Dot))
+	ed.deleteRange(start, ed.buf.Dot)
+}
+
+func biKillLineRight(ed *Editor) {
+	_, end, _ := motionToEOL(ed.buf.Text, ed.buf.Dot, 1)
+	ed.setRegister(0, ed.bufferRange(ed.buf.Dot, end))
+	ed.deleteRange(ed.buf.Dot, end)
+}
+
+func biKillWordLeft(ed *Editor) {
+	start, _, ok := motionWordBackward(ed.buf.Text, ed.buf.Dot, 1)
+	if !ok {
+		return
+	}
+	ed.setRegister(0, ed.bufferRange(start, ed.buf.Dot))
+	ed.deleteRange(start, ed.buf.Dot)
+}
+
+func biKillRuneLeft(ed *Editor) {
+	if ed.buf.Dot == 0 {
+		return
+	}
+	ed.deleteRange(ed.buf.Dot-1, ed.buf.Dot)
+}
+
+func biKillRuneRight(ed *Editor) {
+	if ed.buf.Dot >= len(ed.buf.Text) {
+		return
+	}
+	ed.deleteRange(ed.buf.Dot, ed.buf.Dot+1)
+}
+
+// biStartMode returns a Builtin impl that switches the editor's base
+// mode to name, for the start-*/cancel-*/accept-* bindings in
+// defaultBindings.
+func biStartMode(name string) func(ed *Editor) {
+	return func(ed *Editor) { ed.mode.setMode(name) }
+}
@@ -0,0 +1,28 @@
+package edit
+
+import "testing"
+
+func TestWireDefaultBindingsPopulatesCommandMode(t *testing.T) {
+	defer func(saved map[string]*bindingNode) { keyBindings = saved }(keyBindings)
+	keyBindings = map[string]*bindingNode{modeCommand: newBindingNode()}
+
+	wireDefaultBindings(modeCommand)
+
+	ed := &Editor{buf: Buffer{Text: "abc", Dot: 1}}
+	node := keyBindings[modeCommand].lookup(Key{'h', 0})
+	if node == nil || !node.isLeaf() {
+		t.Fatalf("expected 'h' to be bound in modeCommand after wireDefaultBindings")
+	}
+	node.caller.Call(ed)
+	if ed.buf.Dot != 0 {
+		t.Fatalf("move-dot-left via wired binding left dot at %d, want 0", ed.buf.Dot)
+	}
+}
+
+func TestDefaultInsertUsesLastKey(t *testing.T) {
+	ed := &Editor{buf: Buffer{Text: "ac", Dot: 1}, lastKey: Key{'b', 0}}
+	biDefaultInsert(ed)
+	if ed.buf.Text != "abc" {
+		t.Fatalf("buffer after default-insert = %q, want %q", ed.buf.Text, "abc")
+	}
+}
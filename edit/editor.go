@@ -0,0 +1,200 @@
+package edit
+
+import (
+	"time"
+
+	"github.com/elves/elvish/eval"
+)
+
+// Editor is the interactive line editor that the binding, mode, vi-grammar
+// and notification state added alongside it hang off of.
+type Editor struct {
+	evaler *eval.Evaler
+
+	mode      modeState
+	seq       seqState
+	modeStack []string
+
+	buf                     Buffer
+	sel                     *region
+	registers               map[rune]string
+	vi                      viState
+	viPendingTextObjectKind rune
+	lastKey                 Key
+
+	notifier *notifier
+}
+
+// NewEditor creates an Editor wired up to ev, including the notifier
+// goroutine that Notifyf/NotifyValue post to; without it those calls would
+// nil-panic on the first notification.
+func NewEditor(ev *eval.Evaler) *Editor {
+	ed := &Editor{evaler: ev}
+	ed.notifier = newNotifier(ed)
+	return ed
+}
+
+// renderNotification is called by the notifier's single consumer goroutine
+// for each notification, in arrival order; it owns whatever drawing the
+// notification area needs.
+func (ed *Editor) renderNotification(note notification) {}
+
+// region is a range of the buffer, used both for the current selection (if
+// any) and to remember where a filter function's stdin came from so its
+// stdout can replace exactly that range.
+type region struct {
+	start, end int
+}
+
+// Buffer is the current line being edited: its text and the position of
+// the cursor (dot) within it.
+type Buffer struct {
+	Text string
+	Dot  int
+}
+
+// buffer returns the current buffer text and dot, for motions and text
+// objects to read.
+func (ed *Editor) buffer() (string, int) {
+	return ed.buf.Text, ed.buf.Dot
+}
+
+// bufferRange returns the buffer text in [start, end), clamped to the
+// buffer's bounds.
+func (ed *Editor) bufferRange(start, end int) string {
+	if start < 0 {
+		start = 0
+	}
+	if end > len(ed.buf.Text) {
+		end = len(ed.buf.Text)
+	}
+	return ed.buf.Text[start:end]
+}
+
+// deleteRange removes [start, end) from the buffer and leaves the dot at
+// start.
+func (ed *Editor) deleteRange(start, end int) {
+	ed.buf.Text = ed.buf.Text[:start] + ed.buf.Text[end:]
+	ed.buf.Dot = start
+}
+
+// insertAt inserts text at pos and leaves the dot just after it.
+func (ed *Editor) insertAt(pos int, text string) {
+	ed.buf.Text = ed.buf.Text[:pos] + text + ed.buf.Text[pos:]
+	ed.buf.Dot = pos + len(text)
+}
+
+// insertAtDot inserts text at the current dot.
+func (ed *Editor) insertAtDot(text string) {
+	ed.insertAt(ed.buf.Dot, text)
+}
+
+// setRegister stores text under the named register (name == 0 for the
+// unnamed register), generalizing the kill-ring to a map of registers so
+// that "ay/"ap can target a register by name.
+func (ed *Editor) setRegister(name rune, text string) {
+	if ed.registers == nil {
+		ed.registers = map[rune]string{}
+	}
+	ed.registers[name] = text
+}
+
+// getRegister returns the text last stored under name, or "" if none.
+func (ed *Editor) getRegister(name rune) string {
+	return ed.registers[name]
+}
+
+// pasteRegister implements vi's p/P: paste the named register's contents
+// after (p) or before (P) the dot.
+func (ed *Editor) pasteRegister(name rune, after bool) {
+	text := ed.getRegister(name)
+	if text == "" {
+		return
+	}
+	pos := ed.buf.Dot
+	if after && pos < len(ed.buf.Text) {
+		pos++
+	}
+	ed.insertAt(pos, text)
+}
+
+// stdinRegion resolves a stdinSource to the region of the buffer it reads
+// from and that region's text, for EvalCaller.Call to pipe into a bound
+// function's stdin and, for stdoutReplace, to overwrite afterwards.
+func (ed *Editor) stdinRegion(source stdinSource) (region, string) {
+	switch source {
+	case stdinBuffer:
+		r := region{0, len(ed.buf.Text)}
+		return r, ed.buf.Text
+	case stdinSelection:
+		if ed.sel == nil {
+			return region{ed.buf.Dot, ed.buf.Dot}, ""
+		}
+		return *ed.sel, ed.bufferRange(ed.sel.start, ed.sel.end)
+	case stdinLine:
+		start, _, _ := motionToSOL(ed.buf.Text, ed.buf.Dot, 1)
+		_, end, _ := motionToEOL(ed.buf.Text, ed.buf.Dot, 1)
+		r := region{start, end}
+		return r, ed.bufferRange(start, end)
+	default:
+		return region{ed.buf.Dot, ed.buf.Dot}, ""
+	}
+}
+
+// replaceRegion replaces r with text and leaves the dot just after it.
+func (ed *Editor) replaceRegion(r region, text string) {
+	ed.buf.Text = ed.buf.Text[:r.start] + text + ed.buf.Text[r.end:]
+	ed.buf.Dot = r.start + len(text)
+}
+
+// modeState tracks the editor's current single buffer mode (insert,
+// command, completion, ...), as distinct from the push/pop mode stack
+// used for overlay modes; see mode.go.
+type modeState struct {
+	cur string
+}
+
+func (m *modeState) Mode() string        { return m.cur }
+func (m *modeState) setMode(name string) { m.cur = name }
+
+// refresh asks the editor to redraw; full forces a full repaint and clear
+// additionally clears the screen first. It is called from ed.Run's own
+// goroutine only, including for the pending-sequence timeout, so it never
+// races with key dispatch.
+func (ed *Editor) refresh(full, clear bool) {}
+
+// handleKey is the dispatcher's entry point for a single key: it looks the
+// key up, completing or extending a pending multi-key sequence, and
+// invokes the resulting Caller, if any.
+func (ed *Editor) handleKey(k Key) {
+	ed.lastKey = k
+	if currentMode(ed, ed.mode.Mode()) == modeCommand && handleCommandKey(ed, k) {
+		return
+	}
+	if caller := ed.lookupKey(k); caller != nil {
+		caller.Call(ed)
+	}
+}
+
+// Run is the editor's main input loop. It owns ed.seq: both real key
+// events from in and the pending-sequence timeout are handled on this one
+// goroutine, so ed.seq is never read or written concurrently and the
+// timeout never calls ed.refresh from a goroutine of its own.
+func (ed *Editor) Run(in <-chan Key) {
+	for {
+		var timeout <-chan time.Time
+		if ed.seq.timer != nil {
+			timeout = ed.seq.timer.C
+		}
+		select {
+		case k, ok := <-in:
+			if !ok {
+				return
+			}
+			ed.handleKey(k)
+		case <-timeout:
+			ed.resetSeq()
+			ed.refresh(false, true)
+		}
+	}
+}
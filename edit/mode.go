@@ -0,0 +1,219 @@
+package edit
+
+import (
+	"errors"
+
+	"github.com/elves/elvish/eval"
+)
+
+var (
+	errModeAlreadyRegistered = errors.New("mode already registered")
+	errNoSuchMode            = errors.New("no such mode")
+	errModeStackEmpty        = errors.New("mode stack is empty")
+	errWrongNumArgs          = errors.New("wrong number of arguments")
+	errModeCycle             = errors.New("mode parent chain forms a cycle")
+)
+
+// paramBuiltin is the signature for an edit: builtin that takes Elvish
+// arguments and options directly, unlike Builtin (a plain Caller bound to
+// a key). The eval-facing "edit:" module looks functions up in
+// paramBuiltins by name and calls them with the arguments and options from
+// the call site; edit:new-mode, edit:push-mode and edit:pop-mode are
+// registered here, and edit:bind-filter joins them alongside the Stdin/
+// Stdout options it parses.
+type paramBuiltin func(ed *Editor, args []eval.Value, opts map[string]eval.Value) error
+
+var paramBuiltins = map[string]paramBuiltin{
+	"new-mode":  builtinNewMode,
+	"push-mode": builtinPushMode,
+	"pop-mode":  builtinPopMode,
+}
+
+func asString(v eval.Value) (string, error) {
+	s, ok := v.(eval.String)
+	if !ok {
+		return "", errKeyMustBeString
+	}
+	return string(s), nil
+}
+
+func asOptCaller(v eval.Value) (Caller, error) {
+	if v == nil {
+		return nil, nil
+	}
+	cv, ok := v.(eval.CallerValue)
+	if !ok {
+		return nil, errInvalidFunction
+	}
+	return EvalCaller{Caller: cv}, nil
+}
+
+// builtinNewMode implements
+// edit:new-mode $name &parent='' &on-enter=$nil &on-leave=$nil.
+func builtinNewMode(ed *Editor, args []eval.Value, opts map[string]eval.Value) error {
+	if len(args) != 1 {
+		return errWrongNumArgs
+	}
+	name, err := asString(args[0])
+	if err != nil {
+		return err
+	}
+	parent := ""
+	if v, ok := opts["parent"]; ok {
+		if parent, err = asString(v); err != nil {
+			return err
+		}
+	}
+	onEnter, err := asOptCaller(opts["on-enter"])
+	if err != nil {
+		return err
+	}
+	onLeave, err := asOptCaller(opts["on-leave"])
+	if err != nil {
+		return err
+	}
+	return registerMode(name, parent, onEnter, onLeave)
+}
+
+// builtinPushMode implements edit:push-mode $name.
+func builtinPushMode(ed *Editor, args []eval.Value, opts map[string]eval.Value) error {
+	if len(args) != 1 {
+		return errWrongNumArgs
+	}
+	name, err := asString(args[0])
+	if err != nil {
+		return err
+	}
+	return pushMode(ed, name)
+}
+
+// builtinPopMode implements edit:pop-mode.
+func builtinPopMode(ed *Editor, args []eval.Value, opts map[string]eval.Value) error {
+	if len(args) != 0 {
+		return errWrongNumArgs
+	}
+	return popMode(ed)
+}
+
+// modeSpec is a registered editor mode: a name, an optional parent to
+// inherit unbound keys from (so e.g. an operator-pending mode can fall
+// back to command mode), and hooks run when the mode is pushed onto or
+// popped off the mode stack. Built-in modes (insert, command, ...) are
+// registered through the same mechanism as user-defined ones, at init.
+type modeSpec struct {
+	name    string
+	parent  string
+	onEnter Caller
+	onLeave Caller
+}
+
+var modes = map[string]*modeSpec{}
+
+func registerMode(name, parent string, onEnter, onLeave Caller) error {
+	if _, ok := modes[name]; ok {
+		return errModeAlreadyRegistered
+	}
+	if err := checkNoModeCycle(name, parent); err != nil {
+		return err
+	}
+	modes[name] = &modeSpec{name: name, parent: parent, onEnter: onEnter, onLeave: onLeave}
+	keyBindings[name] = newBindingNode()
+	wireDefaultBindings(name)
+	return nil
+}
+
+// checkNoModeCycle walks parent's chain of ancestors, failing if it ever
+// reaches name (directly, as in parent == name, or transitively through
+// modes registered earlier). Without this, edit:new-mode could register
+// mode A with parent B and then mode B with parent A, and
+// lookupWithParents would spin forever walking that cycle on the next
+// unbound key in either mode.
+func checkNoModeCycle(name, parent string) error {
+	seen := map[string]bool{name: true}
+	for p := parent; p != ""; {
+		if seen[p] {
+			return errModeCycle
+		}
+		seen[p] = true
+		m, ok := modes[p]
+		if !ok {
+			return nil
+		}
+		p = m.parent
+	}
+	return nil
+}
+
+func init() {
+	for _, name := range []string{
+		modeInsert, modeCommand, modeCompletion,
+		modeNavigation, modeHistory, modeHistoryListing, modeLocation,
+	} {
+		// Ignore the error: built-in modes are only ever registered once,
+		// here.
+		registerMode(name, "", nil, nil)
+	}
+}
+
+// pushMode pushes name onto ed's mode stack, running its onEnter hook if
+// any. It is the implementation of edit:push-mode.
+func pushMode(ed *Editor, name string) error {
+	m, ok := modes[name]
+	if !ok {
+		return errNoSuchMode
+	}
+	ed.modeStack = append(ed.modeStack, name)
+	if m.onEnter != nil {
+		m.onEnter.Call(ed)
+	}
+	return nil
+}
+
+// popMode pops the topmost mode off ed's mode stack, running its onLeave
+// hook if any. It is the implementation of edit:pop-mode.
+func popMode(ed *Editor) error {
+	n := len(ed.modeStack)
+	if n == 0 {
+		return errModeStackEmpty
+	}
+	name := ed.modeStack[n-1]
+	ed.modeStack = ed.modeStack[:n-1]
+	if m, ok := modes[name]; ok && m.onLeave != nil {
+		m.onLeave.Call(ed)
+	}
+	return nil
+}
+
+// currentMode returns the name of the mode on top of ed's mode stack, or
+// the base mode if the stack is empty.
+func currentMode(ed *Editor, base string) string {
+	if n := len(ed.modeStack); n > 0 {
+		return ed.modeStack[n-1]
+	}
+	return base
+}
+
+// lookupWithParents looks up k in name's binding trie, falling back to its
+// chain of parent modes when name itself has no binding for k. The
+// visited set is defense in depth against a parent cycle slipping past
+// registerMode's checkNoModeCycle (e.g. a directly constructed modes map
+// in a test): without it, a cycle here would hang Editor.Run's single
+// dispatch goroutine forever instead of just failing the lookup.
+func lookupWithParents(name string, k Key) *bindingNode {
+	seen := map[string]bool{}
+	for name != "" {
+		if seen[name] {
+			return nil
+		}
+		seen[name] = true
+		m, ok := modes[name]
+		if !ok {
+			return nil
+		}
+		if node := keyBindings[name].lookup(k); node != nil {
+			return node
+		}
+		name = m.parent
+	}
+	return nil
+}
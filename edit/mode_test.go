@@ -0,0 +1,101 @@
+package edit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPushPopModeAndParentFallback(t *testing.T) {
+	defer func(saved map[string]*modeSpec) { modes = saved }(modes)
+	defer func(saved map[string]*bindingNode) { keyBindings = saved }(keyBindings)
+	modes = map[string]*modeSpec{}
+	keyBindings = map[string]*bindingNode{}
+
+	if err := registerMode("command", "", nil, nil); err != nil {
+		t.Fatalf("registerMode(command): %v", err)
+	}
+	keyBindings["command"].bind([]Key{{'x', 0}}, fakeCaller("kill-rune-right"))
+
+	entered := false
+	onEnter := fakeFuncCaller(func(ed *Editor) { entered = true })
+	if err := registerMode("operator-pending", "command", onEnter, nil); err != nil {
+		t.Fatalf("registerMode(operator-pending): %v", err)
+	}
+
+	ed := &Editor{}
+	if err := pushMode(ed, "operator-pending"); err != nil {
+		t.Fatalf("pushMode: %v", err)
+	}
+	if !entered {
+		t.Fatalf("expected on-enter hook to run")
+	}
+	if got := currentMode(ed, "command"); got != "operator-pending" {
+		t.Fatalf("currentMode = %q, want operator-pending", got)
+	}
+
+	// "x" isn't bound in operator-pending itself, only in its parent.
+	node := lookupWithParents(currentMode(ed, "command"), Key{'x', 0})
+	if node == nil || node.caller != fakeCaller("kill-rune-right") {
+		t.Fatalf("expected 'x' to resolve via the parent mode, got %+v", node)
+	}
+
+	if err := popMode(ed); err != nil {
+		t.Fatalf("popMode: %v", err)
+	}
+	if got := currentMode(ed, "command"); got != "command" {
+		t.Fatalf("currentMode after pop = %q, want command", got)
+	}
+	if err := popMode(ed); err != errModeStackEmpty {
+		t.Fatalf("popMode on empty stack: got %v, want errModeStackEmpty", err)
+	}
+}
+
+func TestRegisterModeRejectsParentCycle(t *testing.T) {
+	defer func(saved map[string]*modeSpec) { modes = saved }(modes)
+	defer func(saved map[string]*bindingNode) { keyBindings = saved }(keyBindings)
+	modes = map[string]*modeSpec{}
+	keyBindings = map[string]*bindingNode{}
+
+	if err := registerMode("a", "b", nil, nil); err != nil {
+		t.Fatalf("registerMode(a, parent=b): %v", err)
+	}
+	if err := registerMode("b", "a", nil, nil); err != errModeCycle {
+		t.Fatalf("registerMode(b, parent=a): got %v, want errModeCycle", err)
+	}
+	if err := registerMode("c", "c", nil, nil); err != errModeCycle {
+		t.Fatalf("registerMode(c, parent=c): got %v, want errModeCycle", err)
+	}
+}
+
+func TestLookupWithParentsTerminatesOnCycle(t *testing.T) {
+	defer func(saved map[string]*modeSpec) { modes = saved }(modes)
+	defer func(saved map[string]*bindingNode) { keyBindings = saved }(keyBindings)
+
+	// Construct a cycle directly, bypassing registerMode's own check, so
+	// this exercises lookupWithParents' defense in depth rather than the
+	// registration-time guard.
+	modes = map[string]*modeSpec{
+		"a": {name: "a", parent: "b"},
+		"b": {name: "b", parent: "a"},
+	}
+	keyBindings = map[string]*bindingNode{
+		"a": newBindingNode(),
+		"b": newBindingNode(),
+	}
+
+	done := make(chan *bindingNode, 1)
+	go func() { done <- lookupWithParents("a", Key{'x', 0}) }()
+	select {
+	case node := <-done:
+		if node != nil {
+			t.Fatalf("lookupWithParents on a cycle = %+v, want nil", node)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("lookupWithParents did not terminate on a parent cycle")
+	}
+}
+
+type fakeFuncCaller func(ed *Editor)
+
+func (f fakeFuncCaller) Repr(int) string { return "<fn>" }
+func (f fakeFuncCaller) Call(ed *Editor) { f(ed) }
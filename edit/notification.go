@@ -0,0 +1,104 @@
+package edit
+
+import (
+	"fmt"
+	"time"
+)
+
+// notifyLevel classifies a notification for styling by the renderer.
+type notifyLevel int
+
+const (
+	levelInfo notifyLevel = iota
+	levelWarn
+	levelError
+)
+
+// notification is one message destined for the notification area. time is
+// left to the caller to stamp (Editor.Notifyf stamps it with the current
+// time); it is a plain field rather than being filled in here so tests can
+// construct notifications with a fixed time.
+type notification struct {
+	level   notifyLevel
+	source  string
+	message string
+	time    int64
+}
+
+// notifyRingSize bounds how many past notifications edit:notifications
+// can show; older ones are dropped.
+const notifyRingSize = 100
+
+// notifier serializes notifications coming from multiple goroutines (the
+// bound-function output collectors in EvalCaller.Call, in particular) into
+// a single consumer that owns rendering and the history ring buffer. This
+// replaces the old ed.notify, which was called directly from those
+// goroutines and was not concurrency-safe.
+type notifier struct {
+	ch   chan notification
+	ring []notification
+	done chan struct{}
+}
+
+func newNotifier(ed *Editor) *notifier {
+	n := &notifier{
+		ch:   make(chan notification, 32),
+		done: make(chan struct{}),
+	}
+	go n.run(ed)
+	return n
+}
+
+func (n *notifier) run(ed *Editor) {
+	for {
+		select {
+		case note := <-n.ch:
+			n.ring = append(n.ring, note)
+			if len(n.ring) > notifyRingSize {
+				n.ring = n.ring[len(n.ring)-notifyRingSize:]
+			}
+			ed.renderNotification(note)
+		case <-n.done:
+			return
+		}
+	}
+}
+
+func (n *notifier) close() {
+	close(n.done)
+}
+
+func (n *notifier) post(note notification) {
+	n.ch <- note
+}
+
+func (n *notifier) history() []notification {
+	out := make([]notification, len(n.ring))
+	copy(out, n.ring)
+	return out
+}
+
+// Notifyf posts a formatted message from source at the given level. It is
+// safe to call from any goroutine.
+func (ed *Editor) Notifyf(level notifyLevel, source, format string, args ...interface{}) {
+	ed.notifier.post(notification{
+		level:   level,
+		source:  source,
+		message: fmt.Sprintf(format, args...),
+		time:    time.Now().UnixNano(),
+	})
+}
+
+// NotifyValue posts v's representation as an info-level notification from
+// source. It is safe to call from any goroutine.
+func (ed *Editor) NotifyValue(source string, v interface {
+	Repr(indent int) string
+}) {
+	ed.Notifyf(levelInfo, source, "%s", v.Repr(0))
+}
+
+// Notifications returns a snapshot of the recent notification history, most
+// recent last, for edit:notifications.
+func (ed *Editor) Notifications() []notification {
+	return ed.notifier.history()
+}
@@ -0,0 +1,69 @@
+package edit
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitForNotifications polls ed.Notifications until it has at least n
+// entries or the deadline passes, returning the last snapshot seen.
+func waitForNotifications(ed *Editor, n int) []notification {
+	deadline := time.Now().Add(time.Second)
+	for {
+		notes := ed.Notifications()
+		if len(notes) >= n || time.Now().After(deadline) {
+			return notes
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNewEditorWiresNotifier(t *testing.T) {
+	ed := NewEditor(nil)
+	defer ed.notifier.close()
+
+	ed.Notifyf(levelInfo, "test", "hello %d", 1)
+	ed.NotifyValue("test", fakeCaller("v"))
+
+	notes := waitForNotifications(ed, 2)
+	if len(notes) != 2 {
+		t.Fatalf("got %d notifications, want 2", len(notes))
+	}
+	if notes[0].message != "hello 1" {
+		t.Fatalf("notes[0].message = %q, want %q", notes[0].message, "hello 1")
+	}
+}
+
+func TestNotifierConcurrentPosts(t *testing.T) {
+	ed := NewEditor(nil)
+	defer ed.notifier.close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ed.Notifyf(levelInfo, "g", "n%d", i)
+		}(i)
+	}
+	wg.Wait()
+
+	notes := waitForNotifications(ed, 50)
+	if len(notes) != 50 {
+		t.Fatalf("got %d notifications, want 50", len(notes))
+	}
+}
+
+func TestNotifierRingBufferBound(t *testing.T) {
+	ed := NewEditor(nil)
+	defer ed.notifier.close()
+
+	for i := 0; i < notifyRingSize+10; i++ {
+		ed.Notifyf(levelInfo, "g", "n%d", i)
+	}
+	notes := waitForNotifications(ed, notifyRingSize)
+	if len(notes) != notifyRingSize {
+		t.Fatalf("got %d notifications, want the ring capped at %d", len(notes), notifyRingSize)
+	}
+}
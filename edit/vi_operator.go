@@ -0,0 +1,444 @@
+package edit
+
+import "unicode"
+
+// viOperator identifies a pending vi operator (d, c, y) that is waiting for
+// a motion or text object to tell it which range of the buffer to act on.
+type viOperator int
+
+const (
+	noOperator viOperator = iota
+	opDelete
+	opChange
+	opYank
+)
+
+// viState is the operator-pending state machine hanging off modeCommand: a
+// repeat count built up digit by digit, a pending operator, and a pending
+// named register, all of which persist across key presses until a motion
+// or text object completes them.
+type viState struct {
+	count            int  // 0 means "no count given"
+	operator         viOperator
+	register         rune // 0 means the unnamed register
+	awaitingRegister bool // true right after '"', expecting the register letter
+}
+
+func (v *viState) reset() {
+	*v = viState{}
+}
+
+// takeRegister returns the pending named register (0 for unnamed) and
+// resets it, so a register only applies to the operator or paste that
+// immediately follows it, as in vi.
+func (v *viState) takeRegister() rune {
+	r := v.register
+	v.register = 0
+	return r
+}
+
+// pushDigit folds a 1-9 or (once a count has started) 0-9 digit key into
+// the pending count, vi-style ("3" "0" "dw" deletes 30 words).
+func (v *viState) pushDigit(d int) {
+	v.count = v.count*10 + d
+}
+
+// effectiveCount returns the pending count, defaulting to 1 when none was
+// given, and resets it.
+func (v *viState) takeCount() int {
+	if v.count == 0 {
+		return 1
+	}
+	n := v.count
+	v.count = 0
+	return n
+}
+
+// motion computes the buffer range [start, end) that a motion with the
+// given repeat count spans from dot. ok is false if the motion does not
+// apply (e.g. moving right at the end of the buffer).
+type motion func(buf string, dot, count int) (start, end int, ok bool)
+
+var motions = map[Key]motion{
+	{'w', 0}: motionWordForward,
+	{'b', 0}: motionWordBackward,
+	{'e', 0}: motionWordEnd,
+	{'$', 0}: motionToEOL,
+	{'0', 0}: motionToSOL,
+	{'h', 0}: motionLeft,
+	{'l', 0}: motionRight,
+}
+
+// textObject computes the around span of a text object, given the dot
+// that falls inside it: for "w" the word plus its trailing whitespace,
+// for "(" the balanced parens including the delimiters, and so on.
+// continueOperator narrows this to the inner span via shrinkToInner when
+// the pending kind is 'i' ("iw", "i("), instead of the table dispatching
+// inner vs. around itself by key — that let "aw"/"iw" depend on which
+// function happened to be attached to a key rather than on the kind the
+// user actually typed.
+type textObject func(buf string, dot int) (start, end int, ok bool)
+
+var textObjects = map[Key]textObject{
+	{'w', 0}: textObjectAroundWord,
+	{'"', 0}: textObjectQuoted('"'),
+	{'(', 0}: textObjectPaired('(', ')'),
+	{')', 0}: textObjectPaired('(', ')'),
+	{'p', 0}: textObjectParagraph,
+}
+
+// handleCommandKey implements the vi operator-pending grammar: counts,
+// operators (d, c, y) and the motions/text objects that complete them. It
+// is tried by the dispatcher before falling back to defaultBindings, and
+// returns whether it consumed the key.
+func handleCommandKey(ed *Editor, k Key) bool {
+	vi := &ed.vi
+
+	if vi.awaitingRegister {
+		vi.awaitingRegister = false
+		if k.Mod == 0 && unicode.IsLetter(k.Rune) {
+			vi.register = k.Rune
+		}
+		return true
+	}
+
+	if k.Mod == 0 && k.Rune >= '1' && k.Rune <= '9' ||
+		(vi.count != 0 && k.Mod == 0 && k.Rune == '0') {
+		vi.pushDigit(int(k.Rune - '0'))
+		return true
+	}
+
+	if vi.operator != noOperator {
+		return continueOperator(ed, vi, k)
+	}
+
+	switch k {
+	case Key{'d', 0}:
+		vi.operator = opDelete
+		return true
+	case Key{'c', 0}:
+		vi.operator = opChange
+		return true
+	case Key{'y', 0}:
+		vi.operator = opYank
+		return true
+	case Key{'"', 0}:
+		// The following letter names the register for the operator or
+		// paste that follows; see the awaitingRegister branch above.
+		vi.awaitingRegister = true
+		return true
+	case Key{'p', 0}:
+		ed.pasteRegister(vi.takeRegister(), true)
+		return true
+	case Key{'P', 0}:
+		ed.pasteRegister(vi.takeRegister(), false)
+		return true
+	}
+
+	// k isn't part of the operator-pending grammar at all (a plain motion
+	// like "h"/"l"/"w" handled by the ordinary lookupKey/defaultBindings
+	// path, say). Reset the count and register rather than leaving them to
+	// leak into whatever operator comes next; vi.operator is already
+	// noOperator here, since a pending operator always takes this key via
+	// continueOperator above instead of falling through to here.
+	vi.count = 0
+	vi.register = 0
+	return false
+}
+
+// continueOperator handles the key that follows a pending operator: either
+// a motion, a text-object prefix (i/a), or the operator repeated (dd, cc,
+// yy meaning "whole line").
+func continueOperator(ed *Editor, vi *viState, k Key) bool {
+	count := vi.takeCount()
+
+	if m, ok := motions[k]; ok {
+		buf, dot := ed.buffer()
+		if start, end, ok := m(buf, dot, count); ok {
+			applyOperator(ed, vi.operator, vi.takeRegister(), start, end)
+		}
+		vi.operator = noOperator
+		return true
+	}
+
+	if k == Key{'i', 0} || k == Key{'a', 0} {
+		ed.viPendingTextObjectKind = k.Rune
+		return true
+	}
+
+	if ed.viPendingTextObjectKind != 0 {
+		kind := ed.viPendingTextObjectKind
+		ed.viPendingTextObjectKind = 0
+		if to, ok := textObjects[k]; ok {
+			buf, dot := ed.buffer()
+			if start, end, ok := to(buf, dot); ok {
+				if kind == 'i' {
+					start, end = shrinkToInner(buf, start, end, k)
+				}
+				applyOperator(ed, vi.operator, vi.takeRegister(), start, end)
+			}
+		}
+		vi.operator = noOperator
+		return true
+	}
+
+	// dd, cc, yy: operator acting on the whole current line.
+	isDoubled := (vi.operator == opDelete && k == Key{'d', 0}) ||
+		(vi.operator == opChange && k == Key{'c', 0}) ||
+		(vi.operator == opYank && k == Key{'y', 0})
+	if isDoubled {
+		buf, dot := ed.buffer()
+		start, end, _ := motionToSOL(buf, dot, 1)
+		_, eol, _ := motionToEOL(buf, dot, 1)
+		applyOperator(ed, vi.operator, vi.takeRegister(), start, eol)
+		_ = end
+		vi.operator = noOperator
+		return true
+	}
+
+	vi.operator = noOperator
+	return true
+}
+
+// applyOperator performs the kill/change/yank named by op on buf[start:end],
+// storing the affected text in register (or the unnamed kill-ring register
+// when register is 0) via the existing kill-ring mechanism.
+func applyOperator(ed *Editor, op viOperator, register rune, start, end int) {
+	if start > end {
+		start, end = end, start
+	}
+	text := ed.bufferRange(start, end)
+	switch op {
+	case opYank:
+		ed.setRegister(register, text)
+	case opDelete:
+		ed.setRegister(register, text)
+		ed.deleteRange(start, end)
+	case opChange:
+		ed.setRegister(register, text)
+		ed.deleteRange(start, end)
+		ed.mode.setMode(modeInsert)
+	}
+}
+
+// shrinkToInner narrows an around-object range to its inner range by
+// trimming the delimiters/surrounding whitespace that a/i distinguish.
+func shrinkToInner(buf string, start, end int, delim Key) (int, int) {
+	switch delim {
+	case Key{'(', 0}, Key{')', 0}:
+		if end-start >= 2 {
+			return start + 1, end - 1
+		}
+	case Key{'"', 0}:
+		if end-start >= 2 {
+			return start + 1, end - 1
+		}
+	case Key{'w', 0}:
+		// textObjectAroundWord already extended end over the word's
+		// trailing whitespace; "iw" trims it back off.
+		for end > start && buf[end-1] == ' ' {
+			end--
+		}
+	}
+	return start, end
+}
+
+func motionLeft(buf string, dot, count int) (int, int, bool) {
+	if dot == 0 {
+		return dot, dot, false
+	}
+	start := dot - count
+	if start < 0 {
+		start = 0
+	}
+	return start, dot, true
+}
+
+func motionRight(buf string, dot, count int) (int, int, bool) {
+	if dot >= len(buf) {
+		return dot, dot, false
+	}
+	end := dot + count
+	if end > len(buf) {
+		end = len(buf)
+	}
+	return dot, end, true
+}
+
+func motionToSOL(buf string, dot, count int) (int, int, bool) {
+	start := dot
+	for start > 0 && buf[start-1] != '\n' {
+		start--
+	}
+	return start, dot, true
+}
+
+func motionToEOL(buf string, dot, count int) (int, int, bool) {
+	end := dot
+	for end < len(buf) && buf[end] != '\n' {
+		end++
+	}
+	return dot, end, true
+}
+
+func motionWordForward(buf string, dot, count int) (int, int, bool) {
+	end := dot
+	for i := 0; i < count && end < len(buf); i++ {
+		end = skipWord(buf, end)
+		end = skipSpace(buf, end)
+	}
+	return dot, end, end > dot
+}
+
+func motionWordBackward(buf string, dot, count int) (int, int, bool) {
+	start := dot
+	for i := 0; i < count && start > 0; i++ {
+		start = skipSpaceBackward(buf, start)
+		start = skipWordBackward(buf, start)
+	}
+	return start, dot, start < dot
+}
+
+func motionWordEnd(buf string, dot, count int) (int, int, bool) {
+	end := dot
+	for i := 0; i < count && end < len(buf); i++ {
+		end++
+		end = skipSpace(buf, end)
+		end = skipWord(buf, end)
+	}
+	return dot, end, end > dot
+}
+
+func textObjectInnerWord(buf string, dot int) (int, int, bool) {
+	if dot >= len(buf) {
+		return dot, dot, false
+	}
+	start, end := dot, dot
+	for start > 0 && isWordRune(rune(buf[start-1])) {
+		start--
+	}
+	for end < len(buf) && isWordRune(rune(buf[end])) {
+		end++
+	}
+	return start, end, end > start
+}
+
+func textObjectAroundWord(buf string, dot int) (int, int, bool) {
+	start, end, ok := textObjectInnerWord(buf, dot)
+	if !ok {
+		return start, end, ok
+	}
+	for end < len(buf) && buf[end] == ' ' {
+		end++
+	}
+	return start, end, true
+}
+
+func textObjectParagraph(buf string, dot int) (int, int, bool) {
+	start, end := dot, dot
+	for start > 0 && buf[start-1] != '\n' {
+		start--
+	}
+	for start > 0 {
+		prev := start - 1
+		if buf[prev] == '\n' {
+			break
+		}
+		start = prev
+	}
+	for end < len(buf) && buf[end] != '\n' {
+		end++
+	}
+	return start, end, true
+}
+
+// textObjectQuoted returns a text object matching the contents between a
+// pair of quote runes on the current line.
+func textObjectQuoted(q byte) textObject {
+	return func(buf string, dot int) (int, int, bool) {
+		lineStart, lineEnd, _ := motionToSOL(buf, dot, 1)
+		_, le, _ := motionToEOL(buf, dot, 1)
+		lineEnd = le
+		open := -1
+		for i := lineStart; i < lineEnd; i++ {
+			if buf[i] == q {
+				if open == -1 {
+					open = i
+				} else {
+					if dot >= open && dot <= i {
+						return open, i + 1, true
+					}
+					open = -1
+				}
+			}
+		}
+		return dot, dot, false
+	}
+}
+
+// textObjectPaired returns a text object matching the contents between a
+// pair of balanced delimiters such as ( and ).
+func textObjectPaired(open, close byte) textObject {
+	return func(buf string, dot int) (int, int, bool) {
+		depth := 0
+		start := -1
+		for i := dot; i >= 0; i-- {
+			if buf[i] == close && i != dot {
+				depth++
+			} else if buf[i] == open {
+				if depth == 0 {
+					start = i
+					break
+				}
+				depth--
+			}
+		}
+		if start == -1 {
+			return dot, dot, false
+		}
+		depth = 0
+		for i := start; i < len(buf); i++ {
+			if buf[i] == open && i != start {
+				depth++
+			} else if buf[i] == close {
+				if depth == 0 {
+					return start, i + 1, true
+				}
+				depth--
+			}
+		}
+		return dot, dot, false
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func skipWord(buf string, i int) int {
+	for i < len(buf) && isWordRune(rune(buf[i])) {
+		i++
+	}
+	return i
+}
+
+func skipSpace(buf string, i int) int {
+	for i < len(buf) && buf[i] == ' ' {
+		i++
+	}
+	return i
+}
+
+func skipWordBackward(buf string, i int) int {
+	for i > 0 && isWordRune(rune(buf[i-1])) {
+		i--
+	}
+	return i
+}
+
+func skipSpaceBackward(buf string, i int) int {
+	for i > 0 && buf[i-1] == ' ' {
+		i--
+	}
+	return i
+}
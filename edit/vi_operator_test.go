@@ -0,0 +1,142 @@
+package edit
+
+import "testing"
+
+func TestMotionWordForward(t *testing.T) {
+	buf := "foo bar baz"
+	start, end, ok := motionWordForward(buf, 0, 1)
+	if !ok || start != 0 || end != 4 {
+		t.Fatalf("motionWordForward(%q, 0, 1) = %d, %d, %v, want 0, 4, true", buf, start, end, ok)
+	}
+	start, end, ok = motionWordForward(buf, 0, 2)
+	if !ok || start != 0 || end != 8 {
+		t.Fatalf("motionWordForward(%q, 0, 2) = %d, %d, %v, want 0, 8, true", buf, start, end, ok)
+	}
+}
+
+func TestMotionWordBackward(t *testing.T) {
+	buf := "foo bar baz"
+	start, end, ok := motionWordBackward(buf, 8, 1)
+	if !ok || start != 4 || end != 8 {
+		t.Fatalf("motionWordBackward(%q, 8, 1) = %d, %d, %v, want 4, 8, true", buf, start, end, ok)
+	}
+}
+
+func TestTextObjectInnerWord(t *testing.T) {
+	buf := "foo bar baz"
+	start, end, ok := textObjectInnerWord(buf, 5)
+	if !ok || buf[start:end] != "bar" {
+		t.Fatalf("textObjectInnerWord(%q, 5) = %q, want %q", buf, buf[start:end], "bar")
+	}
+}
+
+func TestTextObjectPaired(t *testing.T) {
+	buf := "f(a, g(b), c)"
+	to := textObjectPaired('(', ')')
+	start, end, ok := to(buf, 8) // dot inside the inner (b)
+	if !ok || buf[start:end] != "(b)" {
+		t.Fatalf("textObjectPaired inner = %q, want (b)", buf[start:end])
+	}
+}
+
+func TestTextObjectQuoted(t *testing.T) {
+	buf := `say "hello" now`
+	to := textObjectQuoted('"')
+	start, end, ok := to(buf, 6)
+	if !ok || buf[start:end] != `"hello"` {
+		t.Fatalf("textObjectQuoted = %q, want %q", buf[start:end], `"hello"`)
+	}
+}
+
+func TestShrinkToInner(t *testing.T) {
+	start, end := shrinkToInner("(b)", 0, 3, Key{'(', 0})
+	if start != 1 || end != 2 {
+		t.Fatalf("shrinkToInner((b)) = %d, %d, want 1, 2", start, end)
+	}
+}
+
+func TestApplyOperatorDeleteStoresRegister(t *testing.T) {
+	ed := &Editor{buf: Buffer{Text: "foo bar baz", Dot: 0}}
+	applyOperator(ed, opDelete, 'a', 0, 4)
+	if ed.buf.Text != "bar baz" {
+		t.Fatalf("buffer after delete = %q, want %q", ed.buf.Text, "bar baz")
+	}
+	if got := ed.getRegister('a'); got != "foo " {
+		t.Fatalf("register a = %q, want %q", got, "foo ")
+	}
+}
+
+func TestPasteRegister(t *testing.T) {
+	ed := &Editor{buf: Buffer{Text: "bar", Dot: 0}}
+	ed.setRegister('a', "foo ")
+	ed.pasteRegister('a', false) // P: paste before dot
+	if ed.buf.Text != "foo bar" {
+		t.Fatalf("buffer after P = %q, want %q", ed.buf.Text, "foo bar")
+	}
+}
+
+func TestOperatorWordObjectInnerVsAround(t *testing.T) {
+	// "foo bar baz", dot on "bar": diw deletes just "bar", daw also takes
+	// the trailing space, leaving "baz" immediately after "foo ".
+	ed := &Editor{buf: Buffer{Text: "foo bar baz", Dot: 5}}
+	ed.mode.setMode(modeCommand)
+	handleCommandKey(ed, Key{'d', 0})
+	handleCommandKey(ed, Key{'i', 0})
+	handleCommandKey(ed, Key{'w', 0})
+	if ed.buf.Text != "foo  baz" {
+		t.Fatalf(`diw: buffer = %q, want %q`, ed.buf.Text, "foo  baz")
+	}
+
+	ed = &Editor{buf: Buffer{Text: "foo bar baz", Dot: 5}}
+	ed.mode.setMode(modeCommand)
+	handleCommandKey(ed, Key{'d', 0})
+	handleCommandKey(ed, Key{'a', 0})
+	handleCommandKey(ed, Key{'w', 0})
+	if ed.buf.Text != "foo baz" {
+		t.Fatalf(`daw: buffer = %q, want %q`, ed.buf.Text, "foo baz")
+	}
+}
+
+func TestHandleCommandKeyResetsStaleCount(t *testing.T) {
+	// "3", "h" (a bare motion, not claimed by the operator-pending
+	// grammar) must not leave count=3 lying around for the next operator
+	// to pick up: "3h" then "dw" should delete one word, not three.
+	ed := &Editor{buf: Buffer{Text: "foo bar baz", Dot: 0}}
+	ed.mode.setMode(modeCommand)
+
+	handleCommandKey(ed, Key{'3', 0})
+	if claimed := handleCommandKey(ed, Key{'h', 0}); claimed {
+		t.Fatalf("'h' should not be claimed by the operator-pending grammar")
+	}
+	if ed.vi.count != 0 {
+		t.Fatalf("vi.count after unclaimed key = %d, want 0", ed.vi.count)
+	}
+
+	handleCommandKey(ed, Key{'d', 0})
+	handleCommandKey(ed, Key{'w', 0})
+	if ed.buf.Text != "bar baz" {
+		t.Fatalf(`buffer after dw = %q, want %q`, ed.buf.Text, "bar baz")
+	}
+}
+
+func TestRegisterCapture(t *testing.T) {
+	ed := &Editor{buf: Buffer{Text: "foo bar", Dot: 0}}
+	ed.mode.setMode(modeCommand)
+
+	if !handleCommandKey(ed, Key{'"', 0}) {
+		t.Fatalf(`'"' should be consumed`)
+	}
+	if !ed.vi.awaitingRegister {
+		t.Fatalf(`expected awaitingRegister after '"'`)
+	}
+	handleCommandKey(ed, Key{'a', 0})
+	if ed.vi.register != 'a' {
+		t.Fatalf("register = %q, want 'a'", ed.vi.register)
+	}
+
+	handleCommandKey(ed, Key{'y', 0})
+	handleCommandKey(ed, Key{'w', 0}) // "ayw: yank word into register a
+	if got := ed.getRegister('a'); got != "foo " {
+		t.Fatalf(`"ayw register a = %q, want %q`, got, "foo ")
+	}
+}